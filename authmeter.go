@@ -3,7 +3,9 @@ package authmeter
 import (
 	"errors"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -27,18 +29,7 @@ func New(config ...Config) fiber.Handler {
 	cfg := configDefault(config...)
 
 	// Initialize
-	parts := strings.Split(cfg.KeyLookup, ":")
-	extractor := keyFromHeader(parts[1], cfg.AuthScheme)
-	switch parts[0] {
-	case query:
-		extractor = keyFromQuery(parts[1])
-	case form:
-		extractor = keyFromForm(parts[1])
-	case param:
-		extractor = keyFromParam(parts[1])
-	case cookie:
-		extractor = keyFromCookie(parts[1])
-	}
+	extractor := buildExtractor(cfg.KeyAuthConfig)
 
 	infallibleExtractor := func(c *fiber.Ctx) string {
 		key, err := extractor(c)
@@ -48,57 +39,208 @@ func New(config ...Config) fiber.Handler {
 		return key
 	}
 
-	limiter := cfg.LimiterConfig.LimiterMiddleware.New(cfg.LimiterConfig.into(infallibleExtractor))
+	resolveLimiter := newLimiterResolver(cfg.LimiterConfig, infallibleExtractor)
+	obs := newObservability(cfg.ObservabilityConfig)
 
 	return func(c *fiber.Ctx) error {
 		if cfg.Next != nil && cfg.Next(c) {
 			return c.Next()
 		}
 
-		if err := limiter(c); err != nil {
-			return cfg.ErrorHandler(c, err)
-		}
-
+		// Every one of New()'s own checks — key extraction, validation,
+		// scope, and credit reservation — must run before the rate limiter
+		// is ever consulted. limiter.LimiterHandler implementations call
+		// the real c.Next() internally once they decide a request isn't
+		// rate limited, which synchronously runs the rest of the route's
+		// handler chain — including the protected business handler — to
+		// completion. Calling that any earlier would let the handler run
+		// before New() had finished deciding whether the request is even
+		// allowed, letting a denied request's side effects happen anyway.
+		// The limiter is therefore the last thing this handler touches.
 		key, err := extractor(c)
 		if err != nil {
+			obs.record(c, key, ResultInvalidKey, err)
 			return cfg.ErrorHandler(c, err)
 		}
 
+		validateStart := time.Now()
 		valid, err := cfg.Validator(c, key)
+		obs.metrics.observeStage(stageValidator, time.Since(validateStart))
 		if err != nil {
+			obs.record(c, key, ResultInvalidKey, err)
 			return cfg.ErrorHandler(c, err)
 		}
-		if valid {
-			c.Locals(cfg.ContextKey, key)
+		if !valid {
+			obs.record(c, key, ResultInvalidKey, ErrMissingOrMalformedAPIKey)
+			return cfg.ErrorHandler(c, ErrMissingOrMalformedAPIKey)
 		}
+		c.Locals(cfg.ContextKey, key)
 
-		allowed, err := cfg.Allow(c, cfg.ScopeConfig.Storage, key)
-		if err != nil {
-			return cfg.ErrorHandler(c, err)
-		}
-		if !allowed {
-			return cfg.ErrorHandler(c, ErrAPIKeyNotAllowed)
+		if scopes := requiredScopes(c); len(scopes) > 0 && cfg.ScopeConfig.Resolve != nil {
+			granted, err := cfg.ScopeConfig.Resolve(key)
+			if err != nil {
+				obs.record(c, key, ResultError, err)
+				return cfg.ErrorHandler(c, err)
+			}
+			if !scopesSatisfy(scopes, granted, cfg.ScopeConfig.Matcher) {
+				obs.record(c, key, ResultScopeDenied, ErrAPIKeyNotAllowed)
+				return cfg.ErrorHandler(c, ErrAPIKeyNotAllowed)
+			}
+		} else if cfg.Allow != nil {
+			allowed, err := cfg.Allow(c, cfg.ScopeConfig.Storage, key)
+			if err != nil {
+				obs.record(c, key, ResultError, err)
+				return cfg.ErrorHandler(c, err)
+			}
+			if !allowed {
+				obs.record(c, key, ResultScopeDenied, ErrAPIKeyNotAllowed)
+				return cfg.ErrorHandler(c, ErrAPIKeyNotAllowed)
+			}
 		}
 
 		cost, err := cfg.GetCreditCost(c, cfg.CreditConfig.Storage)
 		if err != nil {
+			obs.record(c, key, ResultError, err)
 			return cfg.ErrorHandler(c, err)
 		}
 
-		balance, err := cfg.GetCreditBalance(cfg.CreditConfig.Storage, key)
-		if err != nil {
-			return cfg.ErrorHandler(c, err)
+		deductStart := time.Now()
+
+		var txID string
+		if cfg.CreditConfig.Transaction != nil {
+			txID, err = cfg.CreditConfig.reserve(key, c.Get("Idempotency-Key"), cost)
+			obs.metrics.observeStage(stageDeduct, time.Since(deductStart))
+			if err != nil {
+				// Only a real ErrCreditsExceeded decision is a business
+				// denial; anything else (a Redis connection failure inside
+				// a CreditTransaction implementation, say) is an
+				// infrastructure error and must not be counted the same
+				// way, or it'll read as a wave of legitimate credit
+				// exhaustion on any dashboard built on this label.
+				result := ResultError
+				if errors.Is(err, ErrCreditsExceeded) {
+					result = ResultCreditsExceeded
+				}
+				obs.record(c, key, result, err)
+				return cfg.ErrorHandler(c, err)
+			}
+			obs.metrics.observeCreditsDeducted(key, cost)
+		} else {
+			balance, err := cfg.GetCreditBalance(cfg.CreditConfig.Storage, key)
+			if err != nil {
+				obs.record(c, key, ResultError, err)
+				return cfg.ErrorHandler(c, err)
+			}
+
+			if !cfg.AllowDebt && (balance < 0 || balance < cost) {
+				obs.record(c, key, ResultCreditsExceeded, ErrCreditsExceeded)
+				if !cfg.LimiterConfig.DisableHeaders {
+					limit := resolveLimiter(key)
+					if _, reset, ok := quotaFor(c, cfg.LimiterConfig.Storage, key, limit, time.Now()); ok {
+						setRetryAfter(c, reset)
+					}
+				}
+				return cfg.ErrorHandler(c, ErrCreditsExceeded)
+			}
+
+			if err := cfg.DeductCredits(cfg.CreditConfig.Storage, key, cost); err != nil {
+				obs.record(c, key, ResultError, err)
+				return cfg.ErrorHandler(c, err)
+			}
+			obs.metrics.observeStage(stageDeduct, time.Since(deductStart))
+			obs.metrics.observeCreditsDeducted(key, cost)
+
+			if cfg.CreditConfig.EmitBalanceHeader {
+				c.Set("X-Credits-Remaining", strconv.Itoa(balance-cost))
+			}
 		}
 
-		if !cfg.AllowDebt && (balance < 0 || balance < cost) {
-			return cfg.ErrorHandler(c, ErrCreditsExceeded)
+		if err := cfg.SuccessHandler(c); err != nil {
+			if cfg.CreditConfig.Transaction != nil {
+				_ = cfg.Transaction.Refund(txID)
+			}
+			return err
 		}
 
-		if err := cfg.DeductCredits(cfg.CreditConfig.Storage, key, cost); err != nil {
-			return cfg.ErrorHandler(c, err)
+		// The rate limiter is the final gate. Its Handler calls the real
+		// c.Next() when the request is allowed, which is what actually
+		// dispatches to the protected route — everything above has already
+		// passed by the time that happens. When it returns, the downstream
+		// handler (and its response status) are already final, so credit
+		// commit/refund can react to what actually happened.
+		limit := resolveLimiter(key)
+		limitErr := limit.Handler(c)
+
+		if !cfg.LimiterConfig.DisableHeaders {
+			if remaining, reset, ok := quotaFor(c, cfg.LimiterConfig.Storage, key, limit, time.Now()); ok {
+				setRateLimitHeaders(c, limit.Max, remaining, reset)
+				if limitErr != nil {
+					setRetryAfter(c, reset)
+				}
+			}
 		}
 
-		return cfg.SuccessHandler(c)
+		if limitErr != nil {
+			obs.metrics.observeLimiter(false)
+			obs.record(c, key, ResultRateLimited, limitErr)
+			if cfg.CreditConfig.Transaction != nil {
+				_ = cfg.Transaction.Refund(txID)
+			}
+			return cfg.ErrorHandler(c, limitErr)
+		}
+		obs.metrics.observeLimiter(true)
+
+		if cfg.CreditConfig.Transaction != nil {
+			if c.Response().StatusCode() >= fiber.StatusBadRequest {
+				if err := cfg.Transaction.Refund(txID); err != nil {
+					return err
+				}
+			} else if err := cfg.Transaction.Commit(txID); err != nil {
+				return err
+			}
+		}
+
+		obs.record(c, key, ResultOK, nil)
+		return limitErr
+	}
+}
+
+// buildExtractor resolves the key extractor for a request. If cfg.Extractor
+// is set it takes over entirely, bypassing KeyLookup. Otherwise KeyLookup is
+// split on "," into a chain of extractors that are tried in order, with the
+// first non-empty key winning; ErrMissingOrMalformedAPIKey is only surfaced
+// once every source in the chain has failed.
+func buildExtractor(cfg KeyAuthConfig) func(c *fiber.Ctx) (string, error) {
+	if cfg.Extractor != nil {
+		return cfg.Extractor
+	}
+
+	lookups := strings.Split(cfg.KeyLookup, ",")
+	extractors := make([]func(c *fiber.Ctx) (string, error), 0, len(lookups))
+	for _, lookup := range lookups {
+		parts := strings.Split(strings.TrimSpace(lookup), ":")
+		extractor := keyFromHeader(parts[1], cfg.AuthScheme)
+		switch parts[0] {
+		case query:
+			extractor = keyFromQuery(parts[1])
+		case form:
+			extractor = keyFromForm(parts[1])
+		case param:
+			extractor = keyFromParam(parts[1])
+		case cookie:
+			extractor = keyFromCookie(parts[1])
+		}
+		extractors = append(extractors, extractor)
+	}
+
+	return func(c *fiber.Ctx) (string, error) {
+		for _, extract := range extractors {
+			key, err := extract(c)
+			if err == nil && key != "" {
+				return key, nil
+			}
+		}
+		return "", ErrMissingOrMalformedAPIKey
 	}
 }
 
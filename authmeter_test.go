@@ -0,0 +1,171 @@
+package authmeter
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNew_RequireScopesBlocksBeforeHandlerRuns(t *testing.T) {
+	handlerRan := false
+
+	app := fiber.New()
+	app.Get("/users",
+		RequireScopes("read:users"),
+		New(Config{
+			KeyAuthConfig: KeyAuthConfig{Validator: func(c *fiber.Ctx, key string) (bool, error) { return true, nil }},
+			ScopeConfig: ScopeConfig{
+				Resolve: func(key string) ([]string, error) { return []string{"write:users"}, nil },
+			},
+			CreditConfig: CreditConfig{
+				GetCreditCost:    func(c *fiber.Ctx, s fiber.Storage) (int, error) { return 1, nil },
+				GetCreditBalance: func(s fiber.Storage, key string) (int, error) { return 100, nil },
+				DeductCredits:    func(s fiber.Storage, key string, cost int) error { return nil },
+			},
+		}),
+		func(c *fiber.Ctx) error {
+			handlerRan = true
+			return c.SendString("ok")
+		},
+	)
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer any-key")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+	if handlerRan {
+		t.Error("protected handler ran despite insufficient scopes")
+	}
+}
+
+func TestNew_RequireScopesAllowsSatisfiedRequest(t *testing.T) {
+	handlerRan := false
+
+	app := fiber.New()
+	app.Get("/users",
+		RequireScopes("read:users"),
+		New(Config{
+			KeyAuthConfig: KeyAuthConfig{Validator: func(c *fiber.Ctx, key string) (bool, error) { return true, nil }},
+			ScopeConfig: ScopeConfig{
+				Resolve: func(key string) ([]string, error) { return []string{"read:*"}, nil },
+			},
+			CreditConfig: CreditConfig{
+				GetCreditCost:    func(c *fiber.Ctx, s fiber.Storage) (int, error) { return 1, nil },
+				GetCreditBalance: func(s fiber.Storage, key string) (int, error) { return 100, nil },
+				DeductCredits:    func(s fiber.Storage, key string, cost int) error { return nil },
+			},
+		}),
+		func(c *fiber.Ctx) error {
+			handlerRan = true
+			return c.SendString("ok")
+		},
+	)
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer any-key")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	if !handlerRan {
+		t.Error("protected handler did not run for a satisfied scope")
+	}
+}
+
+func TestNew_InvalidKeyDeniesRequest(t *testing.T) {
+	handlerRan := false
+
+	app := fiber.New()
+	app.Get("/users",
+		New(Config{
+			KeyAuthConfig: KeyAuthConfig{Validator: func(c *fiber.Ctx, key string) (bool, error) { return false, nil }},
+			ScopeConfig: ScopeConfig{
+				Allow: func(c *fiber.Ctx, s fiber.Storage, key string) (bool, error) { return true, nil },
+			},
+			CreditConfig: CreditConfig{
+				GetCreditCost:    func(c *fiber.Ctx, s fiber.Storage) (int, error) { return 1, nil },
+				GetCreditBalance: func(s fiber.Storage, key string) (int, error) { return 100, nil },
+				DeductCredits:    func(s fiber.Storage, key string, cost int) error { return nil },
+			},
+		}),
+		func(c *fiber.Ctx) error {
+			handlerRan = true
+			return c.SendString("ok")
+		},
+	)
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer any-key")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, fiber.StatusUnauthorized)
+	}
+	if handlerRan {
+		t.Error("handler ran despite Validator returning valid=false")
+	}
+}
+
+// erroringTransaction always fails Reserve with a backend error unrelated
+// to credit exhaustion, the way a CreditTransaction backed by a Redis
+// client would on a connection failure.
+type erroringTransaction struct{}
+
+func (erroringTransaction) Reserve(key string, cost int, allowDebt bool) (string, error) {
+	return "", errors.New("redis: connection refused")
+}
+func (erroringTransaction) Commit(txID string) error { return nil }
+func (erroringTransaction) Refund(txID string) error { return nil }
+
+func TestNew_BackendReserveErrorIsNotReportedAsCreditsExceeded(t *testing.T) {
+	var events []Event
+
+	app := fiber.New()
+	app.Get("/users",
+		New(Config{
+			KeyAuthConfig: KeyAuthConfig{Validator: func(c *fiber.Ctx, key string) (bool, error) { return true, nil }},
+			ScopeConfig:   ScopeConfig{Allow: func(c *fiber.Ctx, s fiber.Storage, key string) (bool, error) { return true, nil }},
+			CreditConfig: CreditConfig{
+				GetCreditCost: func(c *fiber.Ctx, s fiber.Storage) (int, error) { return 1, nil },
+				Transaction:   erroringTransaction{},
+			},
+			ObservabilityConfig: ObservabilityConfig{
+				EventSink: func(ctx context.Context, e Event) { events = append(events, e) },
+			},
+		}),
+		func(c *fiber.Ctx) error { return c.SendString("ok") },
+	)
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer any-key")
+
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("events = %v, want exactly 1", events)
+	}
+	if events[0].Result != ResultError {
+		t.Errorf("Result = %q, want %q", events[0].Result, ResultError)
+	}
+}
@@ -1,12 +1,14 @@
 package authmeter
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/storage/memory"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Config defines the config for middleware.
@@ -15,8 +17,15 @@ type Config struct {
 	// Optional. Default: nil
 	Next func(*fiber.Ctx) bool
 
-	// SuccessHandler defines a function which is executed for a valid key.
-	// Optional. Default: nil
+	// SuccessHandler defines a function which is executed once a request has
+	// cleared key validation, the scope check, and credit reservation, but
+	// before the rate limiter makes its final allow/deny decision. Use it for
+	// side effects (logging, extra headers, etc.) — it is not responsible
+	// for calling c.Next(): the limiter's own handler advances the chain to
+	// the protected route once it confirms the request isn't rate limited,
+	// so that no downstream handler ever runs before New()'s own checks have
+	// all passed.
+	// Optional. Default: a no-op that returns nil
 	SuccessHandler fiber.Handler
 
 	// ErrorHandler defines a function which is executed for an invalid key.
@@ -28,6 +37,30 @@ type Config struct {
 	CreditConfig
 	ScopeConfig
 	KeyAuthConfig
+	ObservabilityConfig
+}
+
+// ObservabilityConfig wires authmeter's decision points up to Prometheus
+// metrics and/or a structured event sink, so operators can monitor and
+// audit the middleware without wrapping it themselves.
+type ObservabilityConfig struct {
+	// MetricsRegisterer, when set, registers authmeter's Prometheus
+	// collectors against it: authmeter_requests_total (by result),
+	// authmeter_limiter_decisions_total (by result),
+	// authmeter_credits_deducted_total (by hashed key), and a
+	// authmeter_stage_duration_seconds histogram for the validator and
+	// credit-deduction stages.
+	//
+	// Default: nil (metrics disabled)
+	MetricsRegisterer prometheus.Registerer
+
+	// EventSink, when set, is called with a structured Event at each
+	// decision point (rate limit, key validation, scope check, credit
+	// deduction) so operators can ship them to their SIEM without
+	// wrapping the middleware.
+	//
+	// Default: nil (no events emitted)
+	EventSink func(context.Context, Event)
 }
 
 type LimiterConfig struct {
@@ -58,7 +91,9 @@ type LimiterConfig struct {
 	// Default: false
 	SkipSuccessfulRequests bool
 
-	// Store is used to store the state of the middleware
+	// Store is used to store the state of the middleware. It accepts any
+	// fiber.Storage, so gofiber/storage/redis or gofiber/storage/postgres
+	// can be used to share limiter state across processes.
 	//
 	// Default: an in memory store for this process only
 	Storage fiber.Storage
@@ -67,44 +102,139 @@ type LimiterConfig struct {
 	//
 	// Default: a new Fixed Window Rate Limiter
 	LimiterMiddleware limiter.LimiterHandler
-}
 
-func (l *LimiterConfig) into(kg func(*fiber.Ctx) string) limiter.Config {
-	return limiter.Config{
-		Max:                    l.Max,
-		KeyGenerator:           kg,
-		Expiration:             l.Expiration,
-		LimitReached:           l.LimitReached,
-		SkipFailedRequests:     l.SkipFailedRequests,
-		SkipSuccessfulRequests: l.SkipSuccessfulRequests,
-		Storage:                l.Storage,
-		LimiterMiddleware:      l.LimiterMiddleware,
-	}
+	// DisableHeaders turns off the RateLimit-Limit, RateLimit-Remaining,
+	// RateLimit-Reset, and Retry-After response headers that are emitted
+	// by default.
+	//
+	// Default: false
+	DisableHeaders bool
+
+	// PerKeyLimits, when set, overrides Max, Expiration, and
+	// LimiterMiddleware on a per-key basis so that different API keys
+	// (e.g. free vs. paid tiers) get different quotas and algorithms.
+	// Returning a non-positive max falls back to the config's defaults
+	// for that key.
+	//
+	// Default: nil
+	PerKeyLimits func(key string) (max int, window time.Duration, algo limiter.LimiterHandler)
 }
 
 type CreditConfig struct {
+	// Storage backs the credit balance. It accepts any fiber.Storage, so
+	// gofiber/storage/redis or gofiber/storage/postgres can be dropped in
+	// to share balances across processes. Two higher-level options build
+	// on top of it: RedisCreditStore talks to Redis directly and mutates
+	// balances atomically via DECRBY/INCRBY; StorageCreditStore works with
+	// any fiber.Storage (e.g. postgres) but can only guard against
+	// concurrent updates within this process, since Get/Set alone has no
+	// conditional-write primitive to make the read-modify-write atomic
+	// across processes.
+	//
+	// Default: an in memory store for this process only
 	Storage fiber.Storage
 
+	// KeyPrefix namespaces the idempotency records the middleware writes
+	// to Storage, so multiple authmeter instances can safely share one
+	// Storage. Balances and reservations written by RedisCreditStore or
+	// StorageCreditStore are not affected by it; they use the prefix
+	// passed to their constructors.
+	//
+	// Default: "" (no prefix)
+	KeyPrefix string
+
 	// AllowDebt defines if a user is allowed to go into debt.
 	// If cost > balance, the user will be denied access.
 	AllowDebt bool
 
+	// EmitBalanceHeader adds an X-Credits-Remaining response header set to
+	// the key's balance after deduction. Only applies to the legacy
+	// GetCreditBalance+DeductCredits flow; Transaction-based requests
+	// don't expose a balance to report.
+	//
+	// Default: false
+	EmitBalanceHeader bool
+
 	GetCreditCost func(*fiber.Ctx, fiber.Storage) (int, error)
 
 	GetCreditBalance func(fiber.Storage, string) (int, error)
 
 	DeductCredits func(fiber.Storage, string, int) error
+
+	// Transaction, when set, replaces the GetCreditBalance+DeductCredits
+	// flow with an atomic reserve/commit/refund cycle: credits are
+	// reserved before SuccessHandler runs, committed on a 2xx/3xx
+	// response, and refunded on failure, so a downstream 5xx never
+	// leaves a key debited for work it didn't get.
+	//
+	// Default: nil
+	Transaction CreditTransaction
+
+	// IdempotencyTTL controls how long a transaction ID is remembered
+	// against the Idempotency-Key request header so retries of the same
+	// logical request reuse the original reservation instead of
+	// double-charging. Only used when Transaction is set.
+	//
+	// Default: 24 * time.Hour
+	IdempotencyTTL time.Duration
+}
+
+// CreditTransaction lets credit reservation, commit, and refund happen as
+// three discrete steps so the middleware never debits a key for a request
+// the downstream handler ultimately failed.
+type CreditTransaction interface {
+	// Reserve holds cost credits against key and returns an opaque
+	// transaction ID to later Commit or Refund. allowDebt mirrors
+	// CreditConfig.AllowDebt: when true, Reserve must still succeed (and
+	// return a usable txID) even if debiting cost takes the balance
+	// negative. The check has to happen inside Reserve, atomically with
+	// the debit itself, rather than as a separate balance read in New() --
+	// otherwise a concurrent request could debit the balance between the
+	// read and the write.
+	Reserve(key string, cost int, allowDebt bool) (txID string, err error)
+
+	// Commit finalizes a reservation, permanently debiting the credits.
+	Commit(txID string) error
+
+	// Refund releases a reservation, returning the credits to key.
+	Refund(txID string) error
 }
 
 type ScopeConfig struct {
+	// Storage accepts any fiber.Storage, so gofiber/storage/redis or
+	// gofiber/storage/postgres can be used to share scope state across
+	// processes.
+	//
+	// Default: an in memory store for this process only
 	Storage fiber.Storage
 
+	// Allow is a general-purpose authorization hook, consulted for routes
+	// that don't declare required scopes via RequireScopes.
 	Allow func(c *fiber.Ctx, storage fiber.Storage, key string) (bool, error)
+
+	// Resolve returns the scopes granted to an API key. When set, it is
+	// consulted for any route whose handlers include RequireScopes, with
+	// the required scopes intersected against the granted ones via
+	// Matcher.
+	//
+	// Default: nil
+	Resolve func(key string) ([]string, error)
+
+	// Matcher decides whether a granted scope satisfies a required scope,
+	// so that e.g. a granted "read:*" can satisfy a required
+	// "read:users".
+	//
+	// Default: exact match, with a trailing "*" on the granted scope
+	// matching any required scope sharing that prefix.
+	Matcher func(required, granted string) bool
 }
 
 type KeyAuthConfig struct {
 	// KeyLookup is a string in the form of "<source>:<name>" that is used
-	// to extract key from the request.
+	// to extract key from the request. Multiple sources can be tried in
+	// order by separating them with a comma, e.g.
+	// "header:Authorization,cookie:access_token,query:api_key", which lets
+	// a single middleware instance accept keys from several transports.
 	// Optional. Default value "header:Authorization".
 	// Possible values:
 	// - "header:<name>"
@@ -118,7 +248,15 @@ type KeyAuthConfig struct {
 	// Optional. Default value "Bearer".
 	AuthScheme string
 
-	// Validator is a function to validate key.
+	// Extractor, when set, overrides KeyLookup entirely and is used as the
+	// sole source to extract the key from the request.
+	// Optional. Default: nil
+	Extractor func(*fiber.Ctx) (string, error)
+
+	// Validator is a function to validate key. A (false, nil) return is
+	// treated the same as an invalid key: New() records a ResultInvalidKey
+	// event/metric and denies the request via ErrorHandler rather than
+	// letting it proceed.
 	Validator func(*fiber.Ctx, string) (bool, error)
 
 	// Context key to store the bearertoken from the token into context.
@@ -129,7 +267,7 @@ type KeyAuthConfig struct {
 // ConfigDefault is the default config
 var ConfigDefault = Config{
 	SuccessHandler: func(c *fiber.Ctx) error {
-		return c.Next()
+		return nil
 	},
 	ErrorHandler: func(c *fiber.Ctx, err error) error {
 		if errors.Is(err, ErrMissingOrMalformedAPIKey) {
@@ -183,6 +321,7 @@ func configDefault(config ...Config) Config {
 	defaulters := []func(*Config){
 		limiterDefault,
 		creditDefault,
+		scopeDefault,
 		keyAuthDefault,
 	}
 
@@ -209,15 +348,24 @@ func limiterDefault(cfg *Config) {
 	if cfg.LimiterMiddleware == nil {
 		cfg.LimiterMiddleware = ConfigDefault.LimiterMiddleware
 	}
+	if cfg.LimiterConfig.Storage == nil {
+		cfg.LimiterConfig.Storage = memory.New()
+	}
 }
 
 func creditDefault(cfg *Config) {
 	if cfg.CreditConfig.Storage == nil {
 		cfg.CreditConfig.Storage = memory.New()
 	}
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = 24 * time.Hour
+	}
 	if cfg.GetCreditCost == nil {
 		panic("fiber: authmeter middleware requires a GetCreditCost function")
 	}
+	if cfg.Transaction != nil {
+		return
+	}
 	if cfg.GetCreditBalance == nil {
 		panic("fiber: authmeter middleware requires a GetCreditBalance function")
 	}
@@ -230,8 +378,11 @@ func scopeDefault(cfg *Config) {
 	if cfg.ScopeConfig.Storage == nil {
 		cfg.ScopeConfig.Storage = memory.New()
 	}
-	if cfg.ScopeConfig.Allow == nil {
-		panic("fiber: authmeter middleware requires a Allow function")
+	if cfg.ScopeConfig.Matcher == nil {
+		cfg.ScopeConfig.Matcher = defaultScopeMatcher
+	}
+	if cfg.ScopeConfig.Allow == nil && cfg.ScopeConfig.Resolve == nil {
+		panic("fiber: authmeter middleware requires an Allow or Resolve function")
 	}
 }
 
@@ -0,0 +1,34 @@
+package authmeter
+
+// idempotencyStorageKey namespaces idempotency records under KeyPrefix in
+// CreditConfig.Storage so they can't collide with keys written by a
+// GetCreditBalance/DeductCredits implementation sharing the same storage.
+func (cc *CreditConfig) idempotencyStorageKey(key, idempotencyKey string) string {
+	return cc.KeyPrefix + "authmeter:idempotency:" + key + ":" + idempotencyKey
+}
+
+// reserve resolves the transaction ID to use for this request: if an
+// Idempotency-Key header was sent and a prior request already reserved
+// credits for it, the same txID is reused instead of reserving again so a
+// retried request can't double-charge.
+func (cc *CreditConfig) reserve(key, idempotencyKey string, cost int) (txID string, err error) {
+	if idempotencyKey == "" {
+		return cc.Transaction.Reserve(key, cost, cc.AllowDebt)
+	}
+
+	storageKey := cc.idempotencyStorageKey(key, idempotencyKey)
+	if raw, err := cc.Storage.Get(storageKey); err == nil && len(raw) > 0 {
+		return string(raw), nil
+	}
+
+	txID, err = cc.Transaction.Reserve(key, cost, cc.AllowDebt)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cc.Storage.Set(storageKey, []byte(txID), cc.IdempotencyTTL); err != nil {
+		return "", err
+	}
+
+	return txID, nil
+}
@@ -0,0 +1,95 @@
+package authmeter
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/storage/memory"
+)
+
+// fakeTransaction counts Reserve calls so tests can assert idempotent
+// replay doesn't reserve twice.
+type fakeTransaction struct {
+	reserveCalls int
+	nextTxID     int
+}
+
+func (f *fakeTransaction) Reserve(key string, cost int, allowDebt bool) (string, error) {
+	f.reserveCalls++
+	f.nextTxID++
+	return key + "-tx-" + strconv.Itoa(f.nextTxID), nil
+}
+
+func (f *fakeTransaction) Commit(txID string) error { return nil }
+func (f *fakeTransaction) Refund(txID string) error { return nil }
+
+func TestCreditConfig_Reserve_IdempotentReplay(t *testing.T) {
+	tx := &fakeTransaction{}
+	cc := &CreditConfig{
+		Storage:        memory.New(),
+		Transaction:    tx,
+		IdempotencyTTL: time.Minute,
+	}
+
+	first, err := cc.reserve("key1", "idem-1", 5)
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+
+	second, err := cc.reserve("key1", "idem-1", 5)
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+
+	if first != second {
+		t.Errorf("replayed reserve() = %q, want %q (same txID as first)", second, first)
+	}
+	if tx.reserveCalls != 1 {
+		t.Errorf("Transaction.Reserve called %d times, want 1", tx.reserveCalls)
+	}
+}
+
+func TestCreditConfig_Reserve_NoIdempotencyKeyAlwaysReserves(t *testing.T) {
+	tx := &fakeTransaction{}
+	cc := &CreditConfig{
+		Storage:     memory.New(),
+		Transaction: tx,
+	}
+
+	if _, err := cc.reserve("key1", "", 5); err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if _, err := cc.reserve("key1", "", 5); err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+
+	if tx.reserveCalls != 2 {
+		t.Errorf("Transaction.Reserve called %d times, want 2", tx.reserveCalls)
+	}
+}
+
+func TestCreditConfig_Reserve_DifferentIdempotencyKeysReserveSeparately(t *testing.T) {
+	tx := &fakeTransaction{}
+	cc := &CreditConfig{
+		Storage:        memory.New(),
+		Transaction:    tx,
+		IdempotencyTTL: time.Minute,
+	}
+
+	a, err := cc.reserve("key1", "idem-a", 5)
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	b, err := cc.reserve("key1", "idem-b", 5)
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+
+	if a == b {
+		t.Errorf("distinct idempotency keys reused the same txID %q", a)
+	}
+	if tx.reserveCalls != 2 {
+		t.Errorf("Transaction.Reserve called %d times, want 2", tx.reserveCalls)
+	}
+}
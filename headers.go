@@ -0,0 +1,92 @@
+package authmeter
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// xRateLimitRemainingHeader and xRateLimitResetHeader are the header names
+// FixedWindow and SlidingWindow (github.com/gofiber/fiber/v2/middleware/limiter)
+// write into the response themselves once they've made their decision.
+const (
+	xRateLimitRemainingHeader = "X-RateLimit-Remaining"
+	xRateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// quotaFor reports the remaining quota and time-to-reset for limit, the
+// algo New() just ran, by reading back whatever state that specific algo
+// left behind rather than keeping a second, approximate accounting of our
+// own. FixedWindow and SlidingWindow already compute and write accurate
+// X-RateLimit-Remaining/Reset headers into the response as part of their
+// own Handler; TokenBucket is ours, so its remaining/reset is derived
+// directly from the tokens/lastRefill it persists to cfg.Storage. ok is
+// false when neither source applies (an unrecognized custom
+// LimiterMiddleware that doesn't report its own X-RateLimit-* headers),
+// since fabricating a number at that point would be no more honest than
+// the independent counter this replaced.
+func quotaFor(c *fiber.Ctx, storage fiber.Storage, key string, limit resolvedLimit, now time.Time) (remaining int, reset time.Duration, ok bool) {
+	if raw := c.Response().Header.Peek(xRateLimitRemainingHeader); len(raw) > 0 {
+		remaining, _ = strconv.Atoi(string(raw))
+		resetSecs, _ := strconv.Atoi(string(c.Response().Header.Peek(xRateLimitResetHeader)))
+		c.Response().Header.Del(xRateLimitRemainingHeader)
+		c.Response().Header.Del(xRateLimitResetHeader)
+		c.Response().Header.Del("X-RateLimit-Limit")
+		return remaining, time.Duration(resetSecs) * time.Second, true
+	}
+
+	if _, isTokenBucket := limit.Algo.(TokenBucket); isTokenBucket {
+		remaining, reset = tokenBucketQuota(storage, key, limit.Max, limit.Window, now)
+		return remaining, reset, true
+	}
+
+	// FixedWindow and SlidingWindow only write X-RateLimit-* on a request
+	// they let through; on a rejection they instead write Retry-After
+	// directly (and remaining is 0 by definition -- that's why it was
+	// rejected). Read that back rather than leaving the response with no
+	// quota information at all.
+	if raw := c.Response().Header.Peek(fiber.HeaderRetryAfter); len(raw) > 0 {
+		retryAfterSecs, _ := strconv.Atoi(string(raw))
+		return 0, time.Duration(retryAfterSecs) * time.Second, true
+	}
+
+	return 0, 0, false
+}
+
+// setRateLimitHeaders writes the IETF draft RateLimit-* headers. See
+// https://www.ietf.org/archive/id/draft-ietf-httpapi-ratelimit-headers.
+func setRateLimitHeaders(c *fiber.Ctx, max, remaining int, reset time.Duration) {
+	c.Set("RateLimit-Limit", strconv.Itoa(max))
+	c.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(int(reset.Seconds())))
+}
+
+// setRetryAfter writes the Retry-After header, in seconds.
+func setRetryAfter(c *fiber.Ctx, after time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(after.Seconds())))
+}
+
+// tokenBucketQuota computes TokenBucket's own remaining/reset without
+// mutating its stored state, by applying the same continuous-refill
+// formula TokenBucket.New() uses. reset is the time until the bucket is
+// full again, which is 0 once it already is.
+func tokenBucketQuota(storage fiber.Storage, key string, max int, window time.Duration, now time.Time) (remaining int, reset time.Duration) {
+	rate := float64(max) / window.Seconds()
+
+	raw, _ := storage.Get(key)
+	tokens, lastRefill := decodeBucket(raw, max, now)
+	tokens = math.Min(float64(max), tokens+now.Sub(lastRefill).Seconds()*rate)
+
+	remaining = int(tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	missing := float64(max) - tokens
+	if missing <= 0 {
+		return remaining, 0
+	}
+	return remaining, time.Duration(missing / rate * float64(time.Second))
+}
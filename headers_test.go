@@ -0,0 +1,46 @@
+package authmeter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/storage/memory"
+)
+
+// TestTokenBucketQuota_ReflectsRefill is the reproduction from review: after
+// draining a bucket and waiting long enough for a token to refill, the
+// reported quota must reflect that refill rather than staying pinned at the
+// values from the moment the bucket was drained.
+func TestTokenBucketQuota_ReflectsRefill(t *testing.T) {
+	storage := memory.New()
+	const max = 2
+	window := 2 * time.Second
+
+	drainedAt := time.Now()
+	_ = storage.Set("key1", encodeBucket(0, drainedAt), window)
+
+	remaining, _ := tokenBucketQuota(storage, "key1", max, window, drainedAt)
+	if remaining != 0 {
+		t.Fatalf("remaining immediately after draining = %d, want 0", remaining)
+	}
+
+	later := drainedAt.Add(1100 * time.Millisecond) // 1 token/sec refill rate
+	remaining, reset := tokenBucketQuota(storage, "key1", max, window, later)
+	if remaining != 1 {
+		t.Errorf("remaining after 1.1s refill = %d, want 1", remaining)
+	}
+	if reset <= 0 {
+		t.Errorf("reset = %v, want > 0 (bucket not yet full)", reset)
+	}
+}
+
+func TestTokenBucketQuota_FullBucketHasZeroReset(t *testing.T) {
+	storage := memory.New()
+	remaining, reset := tokenBucketQuota(storage, "key1", 5, time.Minute, time.Now())
+	if remaining != 5 {
+		t.Errorf("remaining for an untouched key = %d, want 5 (full)", remaining)
+	}
+	if reset != 0 {
+		t.Errorf("reset = %v, want 0 for an already-full bucket", reset)
+	}
+}
@@ -0,0 +1,107 @@
+package authmeter
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// limiterCacheKey identifies one compiled limiter instance. Two requests
+// that resolve to the same algo/max/window triple share the same instance
+// and therefore the same underlying counters. algo is algoIdentity(...) of
+// the limiter.LimiterHandler rather than the handler value itself, since a
+// user-authored algo is free to hold an uncomparable field (a func or
+// slice), and comparing two such values as a map key panics at request
+// time with "hash of unhashable type" -- exactly the kind of value
+// LimiterMiddleware/PerKeyLimits are documented to accept.
+type limiterCacheKey struct {
+	algo   string
+	max    int
+	window time.Duration
+}
+
+// algoIdentity derives a cache key for a limiter.LimiterHandler without
+// hashing the value itself. Pointer-like kinds (the idiomatic shape for a
+// stateful custom algo) get a type+address identity, so distinct instances
+// of the same type don't collide; anything else falls back to just the
+// type name, which is exact for the common case of a comparable, field-less
+// algo like limiter.FixedWindow{} and degrades gracefully (collapsing
+// distinct configurations of the same type into one cache entry, rather
+// than panicking) for an uncomparable value type.
+func algoIdentity(algo limiter.LimiterHandler) string {
+	v := reflect.ValueOf(algo)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return fmt.Sprintf("%T:%#x", algo, v.Pointer())
+	default:
+		return fmt.Sprintf("%T", algo)
+	}
+}
+
+// resolvedLimit is the compiled limiter handler for one (max, window, algo)
+// triple, along with the max/window/algo themselves so callers that need to
+// report quota (e.g. the RateLimit-* headers) don't have to re-derive them.
+type resolvedLimit struct {
+	Handler fiber.Handler
+	Max     int
+	Window  time.Duration
+	Algo    limiter.LimiterHandler
+}
+
+// newLimiterResolver returns a function that, given a request key, resolves
+// the (max, window, algo) triple to enforce — from PerKeyLimits when set,
+// falling back to the LimiterConfig defaults otherwise — and lazily builds
+// and caches one limiter instance per distinct triple. Caching this way
+// means a key's tier change is reflected on its very next request. Every
+// cached instance shares cfg.Storage and stores its state under the key
+// itself, so a key's recorded usage is not reset when it moves to another
+// triple.
+func newLimiterResolver(cfg LimiterConfig, keyGenerator func(*fiber.Ctx) string) func(key string) resolvedLimit {
+	defaultAlgo := cfg.LimiterMiddleware
+	if defaultAlgo == nil {
+		defaultAlgo = limiter.FixedWindow{}
+	}
+
+	cache := make(map[limiterCacheKey]fiber.Handler)
+	var mu sync.Mutex
+
+	build := func(algo limiter.LimiterHandler, ck limiterCacheKey) fiber.Handler {
+		return algo.New(limiter.Config{
+			Max:                    ck.max,
+			Expiration:             ck.window,
+			KeyGenerator:           keyGenerator,
+			LimitReached:           cfg.LimitReached,
+			SkipFailedRequests:     cfg.SkipFailedRequests,
+			SkipSuccessfulRequests: cfg.SkipSuccessfulRequests,
+			Storage:                cfg.Storage,
+		})
+	}
+
+	return func(key string) resolvedLimit {
+		algo := defaultAlgo
+		ck := limiterCacheKey{algo: algoIdentity(algo), max: cfg.Max, window: cfg.Expiration}
+		if cfg.PerKeyLimits != nil {
+			if max, window, perKeyAlgo := cfg.PerKeyLimits(key); max > 0 {
+				ck.max, ck.window = max, window
+				if perKeyAlgo != nil {
+					algo = perKeyAlgo
+					ck.algo = algoIdentity(algo)
+				}
+			}
+		}
+
+		mu.Lock()
+		handler, ok := cache[ck]
+		if !ok {
+			handler = build(algo, ck)
+			cache[ck] = handler
+		}
+		mu.Unlock()
+
+		return resolvedLimit{Handler: handler, Max: ck.max, Window: ck.window, Algo: algo}
+	}
+}
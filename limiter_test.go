@@ -0,0 +1,56 @@
+package authmeter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// customAlgo is a limiter.LimiterHandler with an uncomparable field, the
+// shape any stateful user-authored algo is likely to take. Prior to keying
+// limiterCacheKey on algoIdentity() instead of the limiter.LimiterHandler
+// value itself, resolving this algo panicked with "hash of unhashable
+// type" the first time the cache was consulted.
+type customAlgo struct {
+	hook func(*fiber.Ctx) error
+}
+
+func (a customAlgo) New(cfg limiter.Config) fiber.Handler {
+	return limiter.FixedWindow{}.New(cfg)
+}
+
+func TestNewLimiterResolver_UncomparableAlgoDoesNotPanic(t *testing.T) {
+	cfg := LimiterConfig{
+		Max:               5,
+		Expiration:        time.Minute,
+		LimiterMiddleware: customAlgo{hook: func(c *fiber.Ctx) error { return nil }},
+	}
+
+	resolve := newLimiterResolver(cfg, func(c *fiber.Ctx) string { return "key1" })
+
+	resolved := resolve("key1")
+	if resolved.Handler == nil {
+		t.Fatal("resolve() returned a nil Handler")
+	}
+
+	// Resolving the same key again looks up the existing cache entry; it
+	// must not panic and must resolve to the same max/window.
+	again := resolve("key1")
+	if resolved.Max != again.Max || resolved.Window != again.Window {
+		t.Errorf("resolve() mismatch across calls: %+v vs %+v", resolved, again)
+	}
+}
+
+func TestAlgoIdentity_DistinguishesPointerInstances(t *testing.T) {
+	a := &customAlgo{hook: func(c *fiber.Ctx) error { return nil }}
+	b := &customAlgo{hook: func(c *fiber.Ctx) error { return nil }}
+
+	if algoIdentity(a) == algoIdentity(b) {
+		t.Error("algoIdentity() collapsed two distinct pointer instances")
+	}
+	if algoIdentity(a) != algoIdentity(a) {
+		t.Error("algoIdentity() not stable across calls for the same instance")
+	}
+}
@@ -0,0 +1,150 @@
+package authmeter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Result labels the outcome of a request as seen by authmeter's metrics and
+// Event records.
+type Result string
+
+const (
+	ResultOK              Result = "ok"
+	ResultInvalidKey      Result = "invalid_key"
+	ResultRateLimited     Result = "rate_limited"
+	ResultCreditsExceeded Result = "credits_exceeded"
+	ResultScopeDenied     Result = "scope_denied"
+	ResultError           Result = "error"
+)
+
+// Event is a structured record of one authmeter decision, emitted to
+// ObservabilityConfig.EventSink.
+type Event struct {
+	Time   time.Time
+	Route  string
+	Key    string
+	Result Result
+	Err    error
+}
+
+// Stage names the latency histogram's "stage" label.
+type stage string
+
+const (
+	stageValidator stage = "validator"
+	stageDeduct    stage = "deduct"
+)
+
+// metrics holds authmeter's Prometheus collectors. A nil *metrics (when no
+// MetricsRegisterer is configured) makes every method a no-op so call sites
+// don't have to guard on it themselves.
+type metrics struct {
+	requestsTotal    *prometheus.CounterVec
+	limiterDecisions *prometheus.CounterVec
+	creditsDeducted  *prometheus.CounterVec
+	stageDuration    *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	if reg == nil {
+		return nil
+	}
+
+	m := &metrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authmeter_requests_total",
+			Help: "Total requests processed by authmeter, labeled by outcome.",
+		}, []string{"result"}),
+		limiterDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authmeter_limiter_decisions_total",
+			Help: "Total rate limiter decisions, labeled by outcome.",
+		}, []string{"result"}),
+		creditsDeducted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "authmeter_credits_deducted_total",
+			Help: "Total credits deducted, labeled by a hashed API key to bound cardinality.",
+		}, []string{"key_hash"}),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "authmeter_stage_duration_seconds",
+			Help: "Latency of the validator and credit-deduction stages.",
+		}, []string{"stage"}),
+	}
+
+	reg.MustRegister(m.requestsTotal, m.limiterDecisions, m.creditsDeducted, m.stageDuration)
+	return m
+}
+
+func (m *metrics) observeRequest(result Result) {
+	if m == nil {
+		return
+	}
+	m.requestsTotal.WithLabelValues(string(result)).Inc()
+}
+
+func (m *metrics) observeLimiter(allowed bool) {
+	if m == nil {
+		return
+	}
+	result := "allowed"
+	if !allowed {
+		result = "limited"
+	}
+	m.limiterDecisions.WithLabelValues(result).Inc()
+}
+
+func (m *metrics) observeCreditsDeducted(key string, cost int) {
+	if m == nil || cost <= 0 {
+		return
+	}
+	m.creditsDeducted.WithLabelValues(hashKey(key)).Add(float64(cost))
+}
+
+func (m *metrics) observeStage(s stage, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.stageDuration.WithLabelValues(string(s)).Observe(d.Seconds())
+}
+
+// hashKey digests an API key down to a short, non-reversible label so the
+// authmeter_credits_deducted_total key_hash label can't blow up cardinality
+// or leak raw keys into a metrics backend.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// observability bundles the metrics and EventSink an instance of New() was
+// configured with.
+type observability struct {
+	metrics *metrics
+	sink    func(context.Context, Event)
+}
+
+func newObservability(cfg ObservabilityConfig) *observability {
+	return &observability{
+		metrics: newMetrics(cfg.MetricsRegisterer),
+		sink:    cfg.EventSink,
+	}
+}
+
+// record increments the requests_total counter and, if EventSink is set,
+// emits an Event for this decision point.
+func (o *observability) record(c *fiber.Ctx, key string, result Result, err error) {
+	o.metrics.observeRequest(result)
+	if o.sink == nil {
+		return
+	}
+	o.sink(c.Context(), Event{
+		Time:   time.Now(),
+		Route:  c.Route().Path,
+		Key:    key,
+		Result: result,
+		Err:    err,
+	})
+}
@@ -0,0 +1,122 @@
+package authmeter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCreditStore implements GetCreditBalance, DeductCredits, and the
+// Reserve/Commit/Refund hooks of CreditTransaction directly against Redis,
+// using INCRBY/DECRBY so balance mutation is atomic without the
+// read-then-write round trip a plain fiber.Storage requires.
+type RedisCreditStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCreditStore returns a RedisCreditStore whose keys are namespaced
+// under prefix (e.g. "authmeter:credits:").
+func NewRedisCreditStore(client *redis.Client, prefix string) *RedisCreditStore {
+	return &RedisCreditStore{client: client, prefix: prefix}
+}
+
+func (s *RedisCreditStore) balanceKey(key string) string {
+	return s.prefix + key
+}
+
+func (s *RedisCreditStore) reservationKey(txID string) string {
+	return s.prefix + "tx:" + txID
+}
+
+// GetCreditBalance satisfies CreditConfig.GetCreditBalance.
+func (s *RedisCreditStore) GetCreditBalance(_ fiber.Storage, key string) (int, error) {
+	balance, err := s.client.Get(context.Background(), s.balanceKey(key)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(balance), nil
+}
+
+// DeductCredits satisfies CreditConfig.DeductCredits, debiting cost credits
+// atomically via DECRBY.
+func (s *RedisCreditStore) DeductCredits(_ fiber.Storage, key string, cost int) error {
+	return s.client.DecrBy(context.Background(), s.balanceKey(key), int64(cost)).Err()
+}
+
+// Reserve satisfies CreditTransaction. It debits cost from the balance up
+// front via DECRBY and records the reservation so Commit/Refund know what
+// to finalize or give back. If the debit takes the balance negative and
+// allowDebt is false, the debit is undone and ErrCreditsExceeded is
+// returned; if allowDebt is true, the negative balance is kept, matching
+// the legacy GetCreditBalance/DeductCredits flow's AllowDebt semantics.
+func (s *RedisCreditStore) Reserve(key string, cost int, allowDebt bool) (string, error) {
+	ctx := context.Background()
+	txID := key + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	balance, err := s.client.DecrBy(ctx, s.balanceKey(key), int64(cost)).Result()
+	if err != nil {
+		return "", err
+	}
+	if balance < 0 && !allowDebt {
+		_ = s.client.IncrBy(ctx, s.balanceKey(key), int64(cost)).Err()
+		return "", ErrCreditsExceeded
+	}
+
+	record := key + "|" + strconv.Itoa(cost)
+	if err := s.client.Set(ctx, s.reservationKey(txID), record, 0).Err(); err != nil {
+		return "", err
+	}
+	return txID, nil
+}
+
+// Commit satisfies CreditTransaction. The credits were already debited in
+// Reserve, so committing just drops the reservation record.
+func (s *RedisCreditStore) Commit(txID string) error {
+	return s.client.Del(context.Background(), s.reservationKey(txID)).Err()
+}
+
+// Refund satisfies CreditTransaction. It credits back the reserved amount
+// and drops the reservation record; a missing record (already committed or
+// refunded) is treated as a no-op so retries are safe.
+func (s *RedisCreditStore) Refund(txID string) error {
+	ctx := context.Background()
+
+	raw, err := s.client.Get(ctx, s.reservationKey(txID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	key, cost, err := decodeReservation(raw)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.IncrBy(ctx, s.balanceKey(key), int64(cost)).Err(); err != nil {
+		return err
+	}
+	return s.client.Del(ctx, s.reservationKey(txID)).Err()
+}
+
+func decodeReservation(raw string) (key string, cost int, err error) {
+	parts := strings.SplitN(raw, "|", 2)
+	if len(parts) != 2 {
+		return "", 0, errors.New("authmeter: malformed reservation record")
+	}
+	cost, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, err
+	}
+	return parts[0], cost, nil
+}
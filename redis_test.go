@@ -0,0 +1,149 @@
+package authmeter
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisCreditStore(t *testing.T) *RedisCreditStore {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewRedisCreditStore(client, "authmeter:credits:")
+}
+
+func TestRedisCreditStore_GetCreditBalance_DefaultsToZero(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 0 {
+		t.Errorf("balance = %d, want 0", balance)
+	}
+}
+
+func TestRedisCreditStore_DeductCredits(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	if err := store.DeductCredits(nil, "key1", 5); err != nil {
+		t.Fatalf("DeductCredits() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != -5 {
+		t.Errorf("balance = %d, want -5", balance)
+	}
+}
+
+func TestRedisCreditStore_ReserveCommit(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	if err := store.DeductCredits(nil, "key1", -10); err != nil { // top up to 10
+		t.Fatalf("DeductCredits() error = %v", err)
+	}
+
+	txID, err := store.Reserve("key1", 4, false)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 6 {
+		t.Errorf("balance after reserve = %d, want 6", balance)
+	}
+
+	if err := store.Commit(txID); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	balance, err = store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 6 {
+		t.Errorf("balance after commit = %d, want 6 (unchanged)", balance)
+	}
+}
+
+func TestRedisCreditStore_ReserveRefund(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	if err := store.DeductCredits(nil, "key1", -10); err != nil { // top up to 10
+		t.Fatalf("DeductCredits() error = %v", err)
+	}
+
+	txID, err := store.Reserve("key1", 4, false)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	if err := store.Refund(txID); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 10 {
+		t.Errorf("balance after refund = %d, want 10 (restored)", balance)
+	}
+}
+
+func TestRedisCreditStore_Refund_MissingReservationIsNoop(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	if err := store.Refund("never-reserved"); err != nil {
+		t.Fatalf("Refund() of an unknown txID should be a no-op, got error = %v", err)
+	}
+}
+
+func TestRedisCreditStore_Reserve_RejectsDebtByDefault(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	if _, err := store.Reserve("key1", 5, false); err != ErrCreditsExceeded {
+		t.Fatalf("Reserve() error = %v, want ErrCreditsExceeded", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 0 {
+		t.Errorf("balance after rejected reserve = %d, want 0 (debit undone)", balance)
+	}
+}
+
+func TestRedisCreditStore_Reserve_AllowsDebtWhenConfigured(t *testing.T) {
+	store := newTestRedisCreditStore(t)
+
+	txID, err := store.Reserve("key1", 5, true)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != -5 {
+		t.Errorf("balance after debt-allowed reserve = %d, want -5", balance)
+	}
+
+	if err := store.Commit(txID); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package authmeter
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requiredScopesLocalsKey is the c.Locals key RequireScopes uses to record
+// the scopes a route needs, for New() to check against the caller's granted
+// scopes.
+const requiredScopesLocalsKey = "required_scopes"
+
+// RequireScopes returns a fiber.Handler that declares the scopes required to
+// access a route. Mount it ahead of authmeter's New() in the chain, since
+// New() reads the scopes back via c.Locals and checks them against
+// ScopeConfig.Resolve and ScopeConfig.Matcher, short-circuiting with
+// ErrAPIKeyNotAllowed if the key's granted scopes don't satisfy them:
+//
+//	app.Get("/users", authmeter.RequireScopes("read:users"), authmeter.New(cfg), handler)
+func RequireScopes(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(requiredScopesLocalsKey, scopes)
+		return c.Next()
+	}
+}
+
+// requiredScopes reads back the scopes a preceding RequireScopes recorded
+// for the current request, if any.
+func requiredScopes(c *fiber.Ctx) []string {
+	scopes, _ := c.Locals(requiredScopesLocalsKey).([]string)
+	return scopes
+}
+
+// defaultScopeMatcher matches a required scope against a granted scope,
+// supporting a Casbin-style trailing wildcard so a granted scope of
+// "read:*" satisfies a required scope of "read:users".
+func defaultScopeMatcher(required, granted string) bool {
+	if required == granted {
+		return true
+	}
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(required, strings.TrimSuffix(granted, "*"))
+	}
+	return false
+}
+
+// scopesSatisfy reports whether every scope in required is satisfied by at
+// least one scope in granted, according to matcher.
+func scopesSatisfy(required, granted []string, matcher func(required, granted string) bool) bool {
+	for _, req := range required {
+		satisfied := false
+		for _, grant := range granted {
+			if matcher(req, grant) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			return false
+		}
+	}
+	return true
+}
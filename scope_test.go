@@ -0,0 +1,44 @@
+package authmeter
+
+import "testing"
+
+func TestDefaultScopeMatcher(t *testing.T) {
+	cases := []struct {
+		required, granted string
+		want              bool
+	}{
+		{"read:users", "read:users", true},
+		{"read:users", "write:users", false},
+		{"read:users", "read:*", true},
+		{"read:users", "write:*", false},
+		{"read:users", "*", true},
+	}
+
+	for _, tc := range cases {
+		if got := defaultScopeMatcher(tc.required, tc.granted); got != tc.want {
+			t.Errorf("defaultScopeMatcher(%q, %q) = %v, want %v", tc.required, tc.granted, got, tc.want)
+		}
+	}
+}
+
+func TestScopesSatisfy(t *testing.T) {
+	cases := []struct {
+		name              string
+		required, granted []string
+		want              bool
+	}{
+		{"no scopes required", nil, nil, true},
+		{"exact match", []string{"read:users"}, []string{"read:users"}, true},
+		{"wildcard match", []string{"read:users"}, []string{"read:*"}, true},
+		{"missing one of several", []string{"read:users", "write:users"}, []string{"read:users"}, false},
+		{"all satisfied by one wildcard", []string{"read:users", "read:orders"}, []string{"read:*"}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := scopesSatisfy(tc.required, tc.granted, defaultScopeMatcher); got != tc.want {
+				t.Errorf("scopesSatisfy(%v, %v) = %v, want %v", tc.required, tc.granted, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package authmeter
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errMalformedCreditRecord is returned by DecodeCreditRecord when raw isn't
+// a value EncodeCreditRecord produced.
+var errMalformedCreditRecord = errors.New("authmeter: malformed credit record")
+
+// EncodeCreditRecord serializes a credit balance and its monotonic update
+// counter into the wire format recommended for GetCreditBalance/DeductCredits
+// implementations built on a plain fiber.Storage (e.g. gofiber/storage/postgres):
+// a varint balance followed by a uvarint version, so a read-modify-write can
+// detect a concurrent update by comparing versions before writing back.
+// Storage backends with native atomic integer ops, like Redis, skip this
+// encoding in favor of INCRBY/DECRBY — see RedisCreditStore.
+func EncodeCreditRecord(balance int64, version uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+binary.MaxVarintLen64)
+	n := binary.PutVarint(buf, balance)
+	n += binary.PutUvarint(buf[n:], version)
+	return buf[:n]
+}
+
+// DecodeCreditRecord reverses EncodeCreditRecord.
+func DecodeCreditRecord(raw []byte) (balance int64, version uint64, err error) {
+	balance, n := binary.Varint(raw)
+	if n <= 0 {
+		return 0, 0, errMalformedCreditRecord
+	}
+	version, n2 := binary.Uvarint(raw[n:])
+	if n2 <= 0 {
+		return 0, 0, errMalformedCreditRecord
+	}
+	return balance, version, nil
+}
+
+// StorageCreditStore implements GetCreditBalance, DeductCredits, and the
+// Reserve/Commit/Refund hooks of CreditTransaction against any fiber.Storage
+// backend (e.g. gofiber/storage/postgres), storing balances in
+// EncodeCreditRecord's varint-balance/version encoding and incrementing the
+// version on every write; the stored version is not compared before writing
+// back. A plain fiber.Storage only exposes Get/Set, with no
+// conditional-write primitive, so the read-modify-write can't be made a
+// single atomic operation the way Redis's DECRBY can: this only guards
+// against concurrent updates within this process, serialized by mu. Sharing one Storage across multiple processes (e.g. several app
+// instances pointed at the same Postgres database) can still race between
+// them. Backends with a native atomic counter should use RedisCreditStore
+// instead, which has no such limitation.
+type StorageCreditStore struct {
+	storage fiber.Storage
+	prefix  string
+	mu      sync.Mutex
+}
+
+// NewStorageCreditStore returns a StorageCreditStore whose keys are
+// namespaced under prefix.
+func NewStorageCreditStore(storage fiber.Storage, prefix string) *StorageCreditStore {
+	return &StorageCreditStore{storage: storage, prefix: prefix}
+}
+
+func (s *StorageCreditStore) balanceKey(key string) string {
+	return s.prefix + key
+}
+
+func (s *StorageCreditStore) reservationKey(txID string) string {
+	return s.prefix + "tx:" + txID
+}
+
+func (s *StorageCreditStore) load(key string) (balance int64, version uint64, err error) {
+	raw, err := s.storage.Get(s.balanceKey(key))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(raw) == 0 {
+		return 0, 0, nil
+	}
+	return DecodeCreditRecord(raw)
+}
+
+func (s *StorageCreditStore) adjust(key string, delta int64, allowDebt bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, version, err := s.load(key)
+	if err != nil {
+		return 0, err
+	}
+	next := balance + delta
+	if next < 0 && !allowDebt {
+		return 0, ErrCreditsExceeded
+	}
+	if err := s.storage.Set(s.balanceKey(key), EncodeCreditRecord(next, version+1), 0); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// GetCreditBalance satisfies CreditConfig.GetCreditBalance.
+func (s *StorageCreditStore) GetCreditBalance(_ fiber.Storage, key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balance, _, err := s.load(key)
+	return int(balance), err
+}
+
+// DeductCredits satisfies CreditConfig.DeductCredits, debiting cost credits.
+func (s *StorageCreditStore) DeductCredits(_ fiber.Storage, key string, cost int) error {
+	_, err := s.adjust(key, -int64(cost), true)
+	return err
+}
+
+// Reserve satisfies CreditTransaction, debiting cost up front and recording
+// the reservation so Commit/Refund know what to finalize or give back.
+func (s *StorageCreditStore) Reserve(key string, cost int, allowDebt bool) (string, error) {
+	if _, err := s.adjust(key, -int64(cost), allowDebt); err != nil {
+		return "", err
+	}
+
+	txID := key + ":" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	record := key + "|" + strconv.Itoa(cost)
+	if err := s.storage.Set(s.reservationKey(txID), []byte(record), 0); err != nil {
+		return "", err
+	}
+	return txID, nil
+}
+
+// Commit satisfies CreditTransaction. The credits were already debited in
+// Reserve, so committing just drops the reservation record.
+func (s *StorageCreditStore) Commit(txID string) error {
+	return s.storage.Delete(s.reservationKey(txID))
+}
+
+// Refund satisfies CreditTransaction. It credits back the reserved amount
+// and drops the reservation record; a missing record (already committed or
+// refunded) is treated as a no-op so retries are safe.
+func (s *StorageCreditStore) Refund(txID string) error {
+	raw, err := s.storage.Get(s.reservationKey(txID))
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	key, cost, err := decodeReservation(string(raw))
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.adjust(key, int64(cost), true); err != nil {
+		return err
+	}
+	return s.storage.Delete(s.reservationKey(txID))
+}
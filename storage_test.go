@@ -0,0 +1,160 @@
+package authmeter
+
+import (
+	"testing"
+
+	"github.com/gofiber/storage/memory"
+)
+
+func TestEncodeDecodeCreditRecord(t *testing.T) {
+	raw := EncodeCreditRecord(-7, 3)
+
+	balance, version, err := DecodeCreditRecord(raw)
+	if err != nil {
+		t.Fatalf("DecodeCreditRecord() error = %v", err)
+	}
+	if balance != -7 {
+		t.Errorf("balance = %d, want -7", balance)
+	}
+	if version != 3 {
+		t.Errorf("version = %d, want 3", version)
+	}
+}
+
+func TestDecodeCreditRecord_Malformed(t *testing.T) {
+	// An empty buffer, and a buffer with an unterminated varint (every byte
+	// has its continuation bit set), both leave binary.Varint nothing
+	// decodable to return.
+	truncated := make([]byte, 11)
+	for i := range truncated {
+		truncated[i] = 0xFF
+	}
+	for _, raw := range [][]byte{{}, truncated} {
+		if _, _, err := DecodeCreditRecord(raw); err != errMalformedCreditRecord {
+			t.Errorf("DecodeCreditRecord(%v) error = %v, want errMalformedCreditRecord", raw, err)
+		}
+	}
+}
+
+func TestStorageCreditStore_GetCreditBalance_DefaultsToZero(t *testing.T) {
+	store := NewStorageCreditStore(memory.New(), "authmeter:credits:")
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 0 {
+		t.Errorf("balance = %d, want 0", balance)
+	}
+}
+
+func TestStorageCreditStore_DeductCredits(t *testing.T) {
+	store := NewStorageCreditStore(memory.New(), "authmeter:credits:")
+
+	if err := store.DeductCredits(nil, "key1", 5); err != nil {
+		t.Fatalf("DeductCredits() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != -5 {
+		t.Errorf("balance = %d, want -5", balance)
+	}
+}
+
+func TestStorageCreditStore_ReserveCommit(t *testing.T) {
+	store := NewStorageCreditStore(memory.New(), "authmeter:credits:")
+
+	if err := store.DeductCredits(nil, "key1", -10); err != nil { // top up to 10
+		t.Fatalf("DeductCredits() error = %v", err)
+	}
+
+	txID, err := store.Reserve("key1", 4, false)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 6 {
+		t.Errorf("balance after reserve = %d, want 6", balance)
+	}
+
+	if err := store.Commit(txID); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	balance, err = store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 6 {
+		t.Errorf("balance after commit = %d, want 6 (unchanged)", balance)
+	}
+}
+
+func TestStorageCreditStore_ReserveRefund(t *testing.T) {
+	store := NewStorageCreditStore(memory.New(), "authmeter:credits:")
+
+	if err := store.DeductCredits(nil, "key1", -10); err != nil { // top up to 10
+		t.Fatalf("DeductCredits() error = %v", err)
+	}
+
+	txID, err := store.Reserve("key1", 4, false)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	if err := store.Refund(txID); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 10 {
+		t.Errorf("balance after refund = %d, want 10 (restored)", balance)
+	}
+}
+
+func TestStorageCreditStore_Reserve_RejectsDebtByDefault(t *testing.T) {
+	store := NewStorageCreditStore(memory.New(), "authmeter:credits:")
+
+	if _, err := store.Reserve("key1", 5, false); err != ErrCreditsExceeded {
+		t.Fatalf("Reserve() error = %v, want ErrCreditsExceeded", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != 0 {
+		t.Errorf("balance after rejected reserve = %d, want 0 (debit not applied)", balance)
+	}
+}
+
+func TestStorageCreditStore_Reserve_AllowsDebtWhenConfigured(t *testing.T) {
+	store := NewStorageCreditStore(memory.New(), "authmeter:credits:")
+
+	txID, err := store.Reserve("key1", 5, true)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	balance, err := store.GetCreditBalance(nil, "key1")
+	if err != nil {
+		t.Fatalf("GetCreditBalance() error = %v", err)
+	}
+	if balance != -5 {
+		t.Errorf("balance after debt-allowed reserve = %d, want -5", balance)
+	}
+
+	if err := store.Commit(txID); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package authmeter
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/gofiber/storage/memory"
+)
+
+// TokenBucket is a limiter.LimiterHandler that grants each key Max tokens
+// per Expiration window, refilled continuously rather than all-at-once, and
+// debits one token per request. Unlike FixedWindow it absorbs short bursts
+// without penalizing a key for the rest of the window.
+type TokenBucket struct{}
+
+// New builds the fiber.Handler for this TokenBucket, satisfying
+// limiter.LimiterHandler.
+func (TokenBucket) New(cfg limiter.Config) fiber.Handler {
+	storage := cfg.Storage
+	if storage == nil {
+		storage = memory.New()
+	}
+	rate := float64(cfg.Max) / cfg.Expiration.Seconds()
+
+	var mu sync.Mutex
+
+	return func(c *fiber.Ctx) error {
+		key := cfg.KeyGenerator(c)
+		now := time.Now()
+
+		mu.Lock()
+		raw, _ := storage.Get(key)
+		tokens, lastRefill := decodeBucket(raw, cfg.Max, now)
+		tokens = math.Min(float64(cfg.Max), tokens+now.Sub(lastRefill).Seconds()*rate)
+
+		if tokens < 1 {
+			mu.Unlock()
+			if cfg.LimitReached != nil {
+				return cfg.LimitReached(c)
+			}
+			return c.SendStatus(fiber.StatusTooManyRequests)
+		}
+
+		tokens--
+		_ = storage.Set(key, encodeBucket(tokens, now), cfg.Expiration)
+		mu.Unlock()
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if (cfg.SkipFailedRequests && status >= fiber.StatusBadRequest) ||
+			(cfg.SkipSuccessfulRequests && status < fiber.StatusBadRequest) {
+			mu.Lock()
+			raw, _ := storage.Get(key)
+			refunded, lastRefill := decodeBucket(raw, cfg.Max, now)
+			refunded = math.Min(float64(cfg.Max), refunded+1)
+			_ = storage.Set(key, encodeBucket(refunded, lastRefill), cfg.Expiration)
+			mu.Unlock()
+		}
+
+		return err
+	}
+}
+
+// encodeBucket and decodeBucket serialize token bucket state as
+// "<tokens>|<lastRefillUnixNano>" so it can round-trip through a plain
+// fiber.Storage byte slice.
+func encodeBucket(tokens float64, lastRefill time.Time) []byte {
+	return []byte(strconv.FormatFloat(tokens, 'f', -1, 64) + "|" + strconv.FormatInt(lastRefill.UnixNano(), 10))
+}
+
+func decodeBucket(raw []byte, max int, now time.Time) (tokens float64, lastRefill time.Time) {
+	if len(raw) == 0 {
+		return float64(max), now
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return float64(max), now
+	}
+	tokens, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return float64(max), now
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return float64(max), now
+	}
+	return tokens, time.Unix(0, nanos)
+}
@@ -0,0 +1,70 @@
+package authmeter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeBucket(t *testing.T) {
+	now := time.Now()
+	raw := encodeBucket(3.5, now)
+
+	tokens, lastRefill := decodeBucket(raw, 10, now.Add(time.Hour))
+	if tokens != 3.5 {
+		t.Errorf("tokens = %v, want 3.5", tokens)
+	}
+	if !lastRefill.Equal(now) {
+		t.Errorf("lastRefill = %v, want %v", lastRefill, now)
+	}
+}
+
+func TestDecodeBucket_EmptyDefaultsToFull(t *testing.T) {
+	now := time.Now()
+	tokens, lastRefill := decodeBucket(nil, 10, now)
+	if tokens != 10 {
+		t.Errorf("tokens = %v, want 10", tokens)
+	}
+	if !lastRefill.Equal(now) {
+		t.Errorf("lastRefill = %v, want %v", lastRefill, now)
+	}
+}
+
+func TestDecodeBucket_Malformed(t *testing.T) {
+	now := time.Now()
+	for _, raw := range [][]byte{[]byte("garbage"), []byte("1.5|notanumber"), []byte("notanumber|123")} {
+		tokens, lastRefill := decodeBucket(raw, 10, now)
+		if tokens != 10 || !lastRefill.Equal(now) {
+			t.Errorf("decodeBucket(%q) = (%v, %v), want (10, %v)", raw, tokens, lastRefill, now)
+		}
+	}
+}
+
+// TestTokenBucketRefillMath exercises the refill formula directly rather
+// than through New(), since New()'s handler reads time.Now() internally
+// and calls c.Next() -- exactly the control flow this series had to stop
+// composing as a subroutine. The math itself (tokens grow at
+// Max/Expiration per second) is what matters here.
+func TestTokenBucketRefillMath(t *testing.T) {
+	const max = 10
+	window := 10 * time.Second
+	rate := float64(max) / window.Seconds() // 1 token/sec
+
+	start := time.Now()
+	tokens := 0.0
+	lastRefill := start
+
+	elapsed := 5 * time.Second
+	now := start.Add(elapsed)
+	refilled := tokens + now.Sub(lastRefill).Seconds()*rate
+	if refilled != 5 {
+		t.Errorf("refilled tokens after 5s at 1/sec = %v, want 5", refilled)
+	}
+
+	// Refilling past Expiration without a cap overshoots Max, which is why
+	// New() clamps the result with math.Min.
+	now = start.Add(window * 3)
+	refilled = tokens + now.Sub(lastRefill).Seconds()*rate
+	if refilled < max {
+		t.Fatalf("uncapped refill should exceed max, got %v", refilled)
+	}
+}